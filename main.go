@@ -1,23 +1,147 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/felixge/httpsnoop"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/yaml.v3"
 )
 
+// duration lets repository configs express timeouts as human strings (e.g.
+// "30s") in YAML while behaving as a plain time.Duration everywhere else.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+type repositoryAuth struct {
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	SSHKeyPath string `yaml:"ssh_key_path"`
+}
+
+func (a repositoryAuth) transportAuth() (transport.AuthMethod, error) {
+	if a.SSHKeyPath != "" {
+		keys, err := ssh.NewPublicKeysFromFile("git", a.SSHKeyPath, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ssh key: %v", err)
+		}
+		return keys, nil
+	}
+	if a.Username != "" || a.Password != "" {
+		return &githttp.BasicAuth{Username: a.Username, Password: a.Password}, nil
+	}
+	return nil, nil
+}
+
+type webhookConfig struct {
+	Provider string `yaml:"provider"` // github, gitea, or gitlab
+	Secret   string `yaml:"secret"`
+}
+
+func (wc webhookConfig) configured() bool {
+	return wc.Provider != "" && wc.Secret != ""
+}
+
+// verify checks a forge's webhook signature against the raw request body.
+// GitHub and Gitea sign the body with HMAC-SHA256 in X-Hub-Signature-256;
+// GitLab instead sends the shared secret verbatim in X-Gitlab-Token.
+func (wc webhookConfig) verify(body []byte, r *http.Request) bool {
+	switch wc.Provider {
+	case "github", "gitea":
+		sig := r.Header.Get("X-Hub-Signature-256")
+		const prefix = "sha256="
+		if !strings.HasPrefix(sig, prefix) {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(wc.Secret))
+		mac.Write(body)
+		expected := prefix + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(expected), []byte(sig))
+	case "gitlab":
+		return hmac.Equal([]byte(r.Header.Get("X-Gitlab-Token")), []byte(wc.Secret))
+	default:
+		return false
+	}
+}
+
+// webhookPayload extracts just enough of a GitHub/Gitea/GitLab push event to
+// route and filter it; the rest of the payload is ignored.
+type webhookPayload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+type hookConfig struct {
+	Command   string            `yaml:"command"`
+	Args      []string          `yaml:"args"`
+	Cwd       string            `yaml:"cwd"`
+	Env       map[string]string `yaml:"env"`
+	RunOnNoop bool              `yaml:"run_on_noop"`
+	Required  bool              `yaml:"required"`
+}
+
 type repositoryConfig struct {
-	Name   string   `yaml:"name"`
-	Local  string   `yaml:"local"`
-	Remote string   `yaml:"remote"`
-	Branch string   `yaml:"branch"`
-	Tokens []string `yaml:"tokens"`
+	Name        string         `yaml:"name"`
+	Local       string         `yaml:"local"`
+	Remote      string         `yaml:"remote"`
+	Branch      string         `yaml:"branch"`
+	Tokens      []string       `yaml:"tokens"`
+	Auth        repositoryAuth `yaml:"auth"`
+	Hooks       []hookConfig   `yaml:"hooks"`
+	SyncTimeout duration       `yaml:"sync_timeout"`
+	Queue       *bool          `yaml:"queue"`
+	Webhook     webhookConfig  `yaml:"webhook"`
+}
+
+// queueEnabled reports whether a request for a repository that is already
+// syncing should wait its turn (true, the default) or be rejected with a
+// 429 (false).
+func (rc repositoryConfig) queueEnabled() bool {
+	return rc.Queue == nil || *rc.Queue
 }
 
 func (rc repositoryConfig) validToken(key string) bool {
@@ -25,10 +149,12 @@ func (rc repositoryConfig) validToken(key string) bool {
 }
 
 type serverConfig struct {
-	Address      string             `yaml:"address"`
-	Port         string             `yaml:"port"`
-	GlobalTokens []string           `yaml:"global_tokens"`
-	Repositories []repositoryConfig `yaml:"repositories"`
+	Address          string             `yaml:"address"`
+	Port             string             `yaml:"port"`
+	GlobalTokens     []string           `yaml:"global_tokens"`
+	Repositories     []repositoryConfig `yaml:"repositories"`
+	MaxParallelSyncs int                `yaml:"max_parallel_syncs"`
+	HooksDir         string             `yaml:"hooks_dir"`
 }
 
 func (sc serverConfig) getRepository(name string) (*repositoryConfig, error) {
@@ -49,8 +175,24 @@ func (sc serverConfig) tokenExists(key string) bool {
 	return false
 }
 
-type repositoryRequest struct {
-	Name string `json:"name"`
+type repoSummary struct {
+	Name   string `json:"name"`
+	Remote string `json:"remote"`
+	Branch string `json:"branch"`
+}
+
+type batchRequest struct {
+	Names []string `json:"names"`
+	All   bool     `json:"all"`
+}
+
+type batchResult struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	DurationMs    int64  `json:"duration_ms"`
+	HeadSHABefore string `json:"head_sha_before,omitempty"`
+	HeadSHAAfter  string `json:"head_sha_after,omitempty"`
 }
 
 func getConfigPath() (string, error) {
@@ -86,6 +228,9 @@ func processConfig(c *serverConfig) error {
 	if c.Port == "" {
 		c.Port = "8654"
 	}
+	if c.MaxParallelSyncs <= 0 {
+		c.MaxParallelSyncs = 4
+	}
 	for i, r := range c.Repositories {
 		if r.Name == "" {
 			return fmt.Errorf("repository config missing name value")
@@ -97,7 +242,10 @@ func processConfig(c *serverConfig) error {
 			return fmt.Errorf("repository config missing remote value")
 		}
 		if r.Branch == "" {
-			r.Branch = "main"
+			c.Repositories[i].Branch = "main"
+		}
+		if r.SyncTimeout.Duration == 0 {
+			c.Repositories[i].SyncTimeout.Duration = 5 * time.Minute
 		}
 		if len(c.GlobalTokens) > 0 {
 			for _, t := range c.GlobalTokens {
@@ -108,149 +256,949 @@ func processConfig(c *serverConfig) error {
 	return nil
 }
 
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "git_sync_requests_total",
+		Help: "Total sync requests handled, labeled by repo and outcome.",
+	}, []string{"repo", "status"})
+
+	syncDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "git_sync_duration_seconds",
+		Help: "Duration of each sync phase in seconds.",
+	}, []string{"repo", "phase"})
+
+	lastSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "git_sync_last_success_timestamp",
+		Help: "Unix timestamp of the last successful sync per repo.",
+	}, []string{"repo"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, syncDurationSeconds, lastSuccessTimestamp)
+}
+
+// repoStatusEntry tracks the outcome of the most recent sync of a
+// repository so it can be reported from GET /repos/{name}/status.
+type repoStatusEntry struct {
+	mu            sync.Mutex
+	LastSyncAt    time.Time `json:"last_sync_at,omitempty"`
+	LastSuccessAt time.Time `json:"last_success_at,omitempty"`
+	LastHeadSHA   string    `json:"last_head_sha,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+func (e *repoStatusEntry) record(headSHA string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.LastSyncAt = time.Now()
+	if err != nil {
+		e.LastError = err.Error()
+		return
+	}
+	e.LastError = ""
+	e.LastSuccessAt = e.LastSyncAt
+	e.LastHeadSHA = headSHA
+}
+
+func (e *repoStatusEntry) snapshot() repoStatusEntry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return repoStatusEntry{
+		LastSyncAt:    e.LastSyncAt,
+		LastSuccessAt: e.LastSuccessAt,
+		LastHeadSHA:   e.LastHeadSHA,
+		LastError:     e.LastError,
+	}
+}
+
+type statusStore struct {
+	mu      sync.Mutex
+	entries map[string]*repoStatusEntry
+}
+
+func newStatusStore(repos []repositoryConfig) *statusStore {
+	s := &statusStore{entries: make(map[string]*repoStatusEntry, len(repos))}
+	for _, r := range repos {
+		s.entries[r.Name] = &repoStatusEntry{}
+	}
+	return s
+}
+
+func (s *statusStore) get(name string) *repoStatusEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[name]
+}
+
 func localPathExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
-func fetchRepository(r repositoryConfig) error {
-	cmd := exec.Command("git", "fetch", "origin", r.Branch)
-	cmd.Dir = r.Local
-	err := cmd.Run()
+func cloneRepository(ctx context.Context, r repositoryConfig) error {
+	auth, err := r.Auth.transportAuth()
+	if err != nil {
+		return fmt.Errorf("failed to configure auth: %v", err)
+	}
+	_, err = git.PlainCloneContext(ctx, r.Local, false, &git.CloneOptions{
+		URL:           r.Remote,
+		Auth:          auth,
+		ReferenceName: plumbing.NewBranchReferenceName(r.Branch),
+		SingleBranch:  true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clone repository: %v", err)
+	}
+	return nil
+}
+
+func fetchRepository(ctx context.Context, r repositoryConfig) error {
+	repo, err := git.PlainOpen(r.Local)
 	if err != nil {
+		return fmt.Errorf("failed to open repository: %v", err)
+	}
+	auth, err := r.Auth.transportAuth()
+	if err != nil {
+		return fmt.Errorf("failed to configure auth: %v", err)
+	}
+	// Leading '+' force-updates the remote-tracking ref on a non-fast-forward
+	// change, matching `git fetch`'s default behavior for a force-pushed or
+	// rebased upstream.
+	refSpec := gitconfig.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", r.Branch, r.Branch))
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{refSpec},
+		Auth:       auth,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("failed to fetch origin: %v", err)
 	}
 	return nil
 }
 
-func resetRepository(r repositoryConfig) error {
-	remote := fmt.Sprintf("origin/%s", r.Branch)
-	cmd := exec.Command("git", "reset", "--hard", remote)
-	cmd.Dir = r.Local
-	err := cmd.Run()
+func resetRepository(ctx context.Context, r repositoryConfig) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo, err := git.PlainOpen(r.Local)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %v", err)
+	}
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", r.Branch), true)
+	if err != nil {
+		return fmt.Errorf("failed to resolve remote branch: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %v", err)
+	}
+	err = wt.Reset(&git.ResetOptions{Mode: git.HardReset, Commit: ref.Hash()})
 	if err != nil {
 		return fmt.Errorf("failed to reset origin: %v", err)
 	}
 	return nil
 }
 
-func cleanRepository(r repositoryConfig) error {
-	cmd := exec.Command("git", "clean", "-fdx")
-	cmd.Dir = r.Local
-	err := cmd.Run()
+func cleanRepository(ctx context.Context, r repositoryConfig) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo, err := git.PlainOpen(r.Local)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %v", err)
+	}
+	err = wt.Clean(&git.CleanOptions{Dir: true})
 	if err != nil {
 		return fmt.Errorf("failed to clean untracked files: %v", err)
 	}
+	// git.CleanOptions has no "-x" equivalent, so gitignored files (stale
+	// build artifacts, etc.) survive a plain Clean. Remove them too, to
+	// match the `git clean -fdx` behavior mirror syncing relies on, but
+	// never a path the index still tracks.
+	if err := removeIgnoredFiles(repo, wt); err != nil {
+		return fmt.Errorf("failed to clean ignored files: %v", err)
+	}
 	return nil
 }
 
-func syncRepository(r repositoryConfig) error {
-	err := fetchRepository(r)
+func removeIgnoredFiles(repo *git.Repository, wt *git.Worktree) error {
+	patterns, err := gitignore.ReadPatterns(wt.Filesystem, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read gitignore patterns: %v", err)
+	}
+	matcher := gitignore.NewMatcher(patterns)
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %v", err)
+	}
+	tracked := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		tracked[e.Name] = true
+	}
+	trackedUnder := func(dir string) bool {
+		prefix := dir + "/"
+		for name := range tracked {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := wt.Filesystem.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if dir == "." && name == ".git" {
+				continue
+			}
+			path := strings.TrimPrefix(dir+"/"+name, "./")
+			if entry.IsDir() {
+				// Never bulk-remove a directory that still holds tracked
+				// content, even if the directory itself matches an ignore
+				// rule (e.g. tracked "dist/keep.go" with "dist/" ignored).
+				if matcher.Match(strings.Split(path, "/"), true) && !trackedUnder(path) {
+					if err := util.RemoveAll(wt.Filesystem, path); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := walk(path); err != nil {
+					return err
+				}
+				continue
+			}
+			if tracked[path] {
+				continue
+			}
+			if matcher.Match(strings.Split(path, "/"), false) {
+				if err := util.RemoveAll(wt.Filesystem, path); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(".")
+}
+
+func headSHA(r repositoryConfig) (string, error) {
+	repo, err := git.PlainOpen(r.Local)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repository: %v", err)
+	}
+	ref, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %v", err)
+	}
+	return ref.Hash().String(), nil
+}
+
+func changedFiles(r repositoryConfig, oldSHA, newSHA string) ([]string, error) {
+	repo, err := git.PlainOpen(r.Local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %v", err)
+	}
+	oldCommit, err := repo.CommitObject(plumbing.NewHash(oldSHA))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve old commit: %v", err)
+	}
+	newCommit, err := repo.CommitObject(plumbing.NewHash(newSHA))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve new commit: %v", err)
+	}
+	oldTree, err := oldCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read old tree: %v", err)
+	}
+	newTree, err := newCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read new tree: %v", err)
+	}
+	changes, err := oldTree.Diff(newTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff trees: %v", err)
+	}
+	var files []string
+	for _, c := range changes {
+		name := c.To.Name
+		if name == "" {
+			name = c.From.Name
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// runHooks runs the repository's post-sync hooks, mirroring the old/new SHA
+// environment that git's post-receive hook exposes. Hooks are skipped when
+// the sync was a no-op unless they opt in with run_on_noop. ctx bounds each
+// hook the same way it bounds the git operations, so a hung required hook
+// can't outlive sync_timeout or a client disconnect.
+func runHooks(ctx context.Context, r repositoryConfig, hooksDir, oldSHA, newSHA string) error {
+	if oldSHA == newSHA {
+		allNoop := true
+		for _, h := range r.Hooks {
+			if h.RunOnNoop {
+				allNoop = false
+				break
+			}
+		}
+		if allNoop {
+			return nil
+		}
+	}
+
+	var files []string
+	if oldSHA != newSHA {
+		var err error
+		files, err = changedFiles(r, oldSHA, newSHA)
+		if err != nil {
+			slog.Warn("failed to compute changed files for hooks", "repo", r.Name, "error", err)
+		}
+	}
+
+	for _, h := range r.Hooks {
+		if oldSHA == newSHA && !h.RunOnNoop {
+			continue
+		}
+
+		command := h.Command
+		if hooksDir != "" && !filepath.IsAbs(command) {
+			command = filepath.Join(hooksDir, command)
+		}
+
+		cwd := h.Cwd
+		if cwd == "" {
+			cwd = r.Local
+		}
+
+		cmd := exec.CommandContext(ctx, command, h.Args...)
+		cmd.Dir = cwd
+		cmd.Env = append(os.Environ(),
+			"GIT_SYNC_REPO_NAME="+r.Name,
+			"GIT_SYNC_LOCAL="+r.Local,
+			"GIT_SYNC_BRANCH="+r.Branch,
+			"GIT_SYNC_OLD_SHA="+oldSHA,
+			"GIT_SYNC_NEW_SHA="+newSHA,
+			"GIT_SYNC_CHANGED_FILES="+strings.Join(files, "\n"),
+		)
+		for k, v := range h.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		slog.Info("ran post-sync hook", "repo", r.Name, "command", h.Command, "stdout", stdout.String(), "stderr", stderr.String())
+		if err != nil {
+			slog.Warn("post-sync hook failed", "repo", r.Name, "command", h.Command, "error", err)
+			if h.Required {
+				return fmt.Errorf("required hook %q failed: %v", h.Command, err)
+			}
+		}
+	}
+	return nil
+}
+
+// performSync runs the fetch/reset/clean pipeline for r and then its
+// post-sync hooks, returning the HEAD SHA before and after the sync. The
+// sync is bounded by r.SyncTimeout, layered on top of ctx so a client
+// disconnect cancels the in-flight git operation either way.
+func performSync(ctx context.Context, r repositoryConfig, hooksDir string) (oldSHA, newSHA string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, r.SyncTimeout.Duration)
+	defer cancel()
+
+	defer func() {
+		if err != nil {
+			requestsTotal.WithLabelValues(r.Name, "error").Inc()
+			return
+		}
+		requestsTotal.WithLabelValues(r.Name, "ok").Inc()
+		lastSuccessTimestamp.WithLabelValues(r.Name).Set(float64(time.Now().Unix()))
+	}()
+
+	oldSHA, shaErr := headSHA(r)
+	if shaErr != nil {
+		slog.Warn("failed to resolve head before sync", "repo", r.Name, "error", shaErr)
+	}
+
+	if err = syncRepository(ctx, r); err != nil {
+		return oldSHA, oldSHA, err
+	}
+
+	newSHA, shaErr = headSHA(r)
+	if shaErr != nil {
+		slog.Warn("failed to resolve head after sync", "repo", r.Name, "error", shaErr)
+		newSHA = oldSHA
+	}
+
+	if err = runHooks(ctx, r, hooksDir, oldSHA, newSHA); err != nil {
+		return oldSHA, newSHA, err
+	}
+
+	return oldSHA, newSHA, nil
+}
+
+func syncRepository(ctx context.Context, r repositoryConfig) error {
+	if !localPathExists(r.Local) {
+		start := time.Now()
+		err := cloneRepository(ctx, r)
+		syncDurationSeconds.WithLabelValues(r.Name, "clone").Observe(time.Since(start).Seconds())
+		if err != nil {
+			return fmt.Errorf("failed to bootstrap repository: %v", err)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	err := fetchRepository(ctx, r)
+	syncDurationSeconds.WithLabelValues(r.Name, "fetch").Observe(time.Since(start).Seconds())
 	if err != nil {
 		return fmt.Errorf("failed to sync repository: %v", err)
 	}
-	err = resetRepository(r)
+
+	start = time.Now()
+	err = resetRepository(ctx, r)
+	syncDurationSeconds.WithLabelValues(r.Name, "reset").Observe(time.Since(start).Seconds())
 	if err != nil {
 		return fmt.Errorf("failed to sync repository: %v", err)
 	}
-	err = cleanRepository(r)
+
+	start = time.Now()
+	err = cleanRepository(ctx, r)
+	syncDurationSeconds.WithLabelValues(r.Name, "clean").Observe(time.Since(start).Seconds())
 	if err != nil {
 		return fmt.Errorf("failed to clean repository: %v", err)
 	}
 	return nil
 }
 
-func main() {
-	configPath, err := getConfigPath()
+func syncRepositoryForBatch(ctx context.Context, r repositoryConfig, hooksDir string, statuses *statusStore) batchResult {
+	result := batchResult{Name: r.Name}
+	start := time.Now()
+
+	before, after, err := performSync(ctx, r, hooksDir)
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.HeadSHABefore = before
+	result.HeadSHAAfter = after
+	statuses.get(r.Name).record(after, err)
 	if err != nil {
-		fmt.Printf("failed to get config path: %v\n", err)
-		os.Exit(1)
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
 	}
 
-	config, err := loadConfig(configPath)
-	if err != nil {
-		fmt.Printf("failed to load config: %v\n", err)
-		os.Exit(1)
+	result.Status = "ok"
+	return result
+}
+
+// syncLocker serializes concurrent syncs of the same repository so two
+// requests don't race on the working tree. Callers that don't want to wait
+// can pass queue=false and get told the repo is busy instead of blocking.
+type syncLocker struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func newSyncLocker() *syncLocker {
+	return &syncLocker{locks: make(map[string]chan struct{})}
+}
+
+func (s *syncLocker) chanFor(name string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.locks[name]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		s.locks[name] = ch
 	}
+	return ch
+}
 
-	err = processConfig(config)
-	if err != nil {
-		fmt.Printf("error in config: %v\n", err)
-		os.Exit(1)
+// acquire locks name. If the repo is already syncing and queue is true, it
+// waits until the lock is released or ctx is canceled. ok is false if the lock is held and queue is
+// false, or if ctx was canceled while waiting.
+func (s *syncLocker) acquire(ctx context.Context, name string, queue bool) (release func(), ok bool) {
+	ch := s.chanFor(name)
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, true
+	default:
 	}
+	if !queue {
+		return nil, false
+	}
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
 
-	connStr := fmt.Sprintf("%s:%s", config.Address, config.Port)
+type ctxKey string
+
+const (
+	ctxKeyRequestID ctxKey = "request_id"
+	ctxKeyToken     ctxKey = "token"
+)
+
+var requestCounter atomic.Uint64
+
+func newRequestID() string {
+	return fmt.Sprintf("%d-%d", os.Getpid(), requestCounter.Add(1))
+}
+
+type middleware func(http.Handler) http.Handler
+
+// chain applies mws in order, so mws[0] is the outermost wrapper.
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := newRequestID()
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyRequestID, id)))
+	})
+}
+
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				slog.Error("panic handling request", "error", rec, "path", r.URL.Path)
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "Internal Server Error\n")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := httpsnoop.CaptureMetrics(next, w, r)
+		slog.Info("request",
+			"request_id", r.Context().Value(ctxKeyRequestID),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", m.Code,
+			"bytes", m.Written,
+			"duration_ms", m.Duration.Milliseconds(),
+			"source_ip", r.Header.Get("x-forwarded-for"),
+		)
+	})
+}
+
+// authMiddleware accepts the token either via X-GIT-SYNC-TOKEN or HTTP Basic
+// auth (where the password is the token) and stashes it in the request
+// context for handlers to check against a specific repository's tokens.
+func authMiddleware(config *serverConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("X-GIT-SYNC-TOKEN")
+			if token == "" {
+				if _, pass, ok := r.BasicAuth(); ok {
+					token = pass
+				}
+			}
+			if token == "" || !config.tokenExists(token) {
+				slog.Warn("invalid or missing token", "source_ip", r.Header.Get("x-forwarded-for"), "path", r.URL.Path)
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprintf(w, "Unauthorized\n")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyToken, token)))
+		})
+	}
+}
+
+func tokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(ctxKeyToken).(string)
+	return token
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "ok\n")
+}
+
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "ready\n")
+}
+
+func listReposHandler(config *serverConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summaries := make([]repoSummary, 0, len(config.Repositories))
+		for _, rc := range config.Repositories {
+			summaries = append(summaries, repoSummary{Name: rc.Name, Remote: rc.Remote, Branch: rc.Branch})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summaries)
+	}
+}
 
-	router := http.NewServeMux()
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Check the token first
-		reqToken := r.Header.Get("X-GIT-SYNC-TOKEN")
-		if reqToken == "" {
-			slog.Warn("token not provided", "source_ip", r.Header.Get("x-forwarded-for"))
+func repoStatusHandler(config *serverConfig, statuses *statusStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		repoConfig, err := config.getRepository(name)
+		if err != nil {
+			slog.Warn("repository not found", "repo", name)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Bad Request: Repository not found: %v\n", err)
+			return
+		}
+		if !repoConfig.validToken(tokenFromContext(r.Context())) {
+			slog.Warn("invalid token for repository", "repo", name)
 			w.WriteHeader(http.StatusUnauthorized)
 			fmt.Fprintf(w, "Unauthorized\n")
 			return
 		}
-		if !config.tokenExists(reqToken) {
-			slog.Warn("invalid token", "source_ip", r.Header.Get("x-forwarded-for"))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Name string `json:"name"`
+			repoStatusEntry
+		}{Name: name, repoStatusEntry: statuses.get(name).snapshot()})
+	}
+}
+
+func syncHandler(config *serverConfig, locker *syncLocker, inFlight *sync.WaitGroup, statuses *statusStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		repoConfig, err := config.getRepository(name)
+		if err != nil {
+			slog.Warn("repository not found", "repo", name)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Bad Request: Repository not found: %v\n", err)
+			return
+		}
+		if !repoConfig.validToken(tokenFromContext(r.Context())) {
+			slog.Warn("invalid token for repository", "repo", name)
 			w.WriteHeader(http.StatusUnauthorized)
 			fmt.Fprintf(w, "Unauthorized\n")
 			return
 		}
-		// token is valid in SOME repo, start processing
-		// return GET requests with nothing
-		if r.Method == "GET" {
-			slog.Warn("hit GET", "source_ip", r.Header.Get("x-forwarded-for"))
-			w.WriteHeader(http.StatusOK)
-			fmt.Fprintf(w, "OK\n")
+		slog.Info(repoConfig.Name, "local", repoConfig.Local, "remote", repoConfig.Remote, "branch", repoConfig.Branch)
+
+		release, ok := locker.acquire(r.Context(), repoConfig.Name, repoConfig.queueEnabled())
+		if !ok {
+			slog.Warn("sync already in progress", "repo", repoConfig.Name)
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, "Sync already in progress for repository %s\n", repoConfig.Name)
 			return
 		}
-		// fail early to reduce indentation
-		if r.Method != "POST" {
-			slog.Warn("invalid method", "source_ip", r.Header.Get("x-forwarded-for"))
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, "GET or POST only\n")
+		inFlight.Add(1)
+		defer inFlight.Done()
+		defer release()
+
+		_, newSHA, err := performSync(r.Context(), *repoConfig, config.HooksDir)
+		statuses.get(repoConfig.Name).record(newSHA, err)
+		if err != nil {
+			slog.Error("sync failed", "repo", repoConfig.Name, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Internal Server Error: %v\n", err)
 			return
 		}
-		// validate payload
-		var repReq repositoryRequest
-		err := json.NewDecoder(r.Body).Decode(&repReq)
+	}
+}
+
+func batchHandler(config *serverConfig, locker *syncLocker, inFlight *sync.WaitGroup, statuses *statusStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var batchReq batchRequest
+		err := json.NewDecoder(r.Body).Decode(&batchReq)
 		if err != nil {
 			slog.Warn("failed to unmarshal body", "source_ip", r.Header.Get("x-forwarded-for"))
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(w, "Bad Request: Failed to unmarshal json body: %v\n", err)
 			return
 		}
-		if repReq.Name == "" {
-			slog.Warn("repository name not provided", "source_ip", r.Header.Get("x-forwarded-for"))
+
+		var targets []repositoryConfig
+		if batchReq.All {
+			targets = config.Repositories
+		} else {
+			if len(batchReq.Names) == 0 {
+				slog.Warn("no repository names provided", "source_ip", r.Header.Get("x-forwarded-for"))
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Bad Request: names or all must be provided\n")
+				return
+			}
+			for _, name := range batchReq.Names {
+				repoConfig, err := config.getRepository(name)
+				if err != nil {
+					slog.Warn("repository not found", "source_ip", r.Header.Get("x-forwarded-for"), "repo", name)
+					w.WriteHeader(http.StatusNotFound)
+					fmt.Fprintf(w, "Bad Request: Repository not found: %v\n", err)
+					return
+				}
+				targets = append(targets, *repoConfig)
+			}
+		}
+
+		// the token must be valid for every repository in the batch, otherwise reject the whole thing
+		token := tokenFromContext(r.Context())
+		for _, t := range targets {
+			if !t.validToken(token) {
+				slog.Warn("invalid token for repository", "source_ip", r.Header.Get("x-forwarded-for"), "repo", t.Name)
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprintf(w, "Unauthorized: token not valid for repository %s\n", t.Name)
+				return
+			}
+		}
+
+		results := make([]batchResult, len(targets))
+		sem := make(chan struct{}, config.MaxParallelSyncs)
+		var wg sync.WaitGroup
+		for i, t := range targets {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, t repositoryConfig) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				release, ok := locker.acquire(r.Context(), t.Name, t.queueEnabled())
+				if !ok {
+					results[i] = batchResult{Name: t.Name, Status: "error", Error: "sync already in progress"}
+					return
+				}
+				inFlight.Add(1)
+				defer inFlight.Done()
+				defer release()
+
+				results[i] = syncRepositoryForBatch(r.Context(), t, config.HooksDir, statuses)
+			}(i, t)
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for _, res := range results {
+			if res.Status != "ok" {
+				status = http.StatusMultiStatus
+				break
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// webhookHandler authenticates a forge-native webhook by its signature
+// rather than X-GIT-SYNC-TOKEN, so a provider can be pointed at git-sync
+// directly. When the route doesn't carry the repo name in its path (the
+// generic POST /webhook used by forges that can't template the URL), the
+// name is taken from the payload's repository.full_name instead.
+func webhookHandler(config *serverConfig, locker *syncLocker, inFlight *sync.WaitGroup, statuses *statusStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Bad Request: failed to read body: %v\n", err)
+			return
+		}
+
+		var payload webhookPayload
+		_ = json.Unmarshal(body, &payload)
+
+		name := r.PathValue("name")
+		if name == "" {
+			name = payload.Repository.FullName
+		}
+		if name == "" {
+			slog.Warn("webhook did not carry a repository name", "source_ip", r.Header.Get("x-forwarded-for"))
 			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Bad Request: Repository name not provided\n")
+			fmt.Fprintf(w, "Bad Request: unable to determine repository name\n")
 			return
 		}
-		repoConfig, err := config.getRepository(repReq.Name)
+
+		repoConfig, err := config.getRepository(name)
 		if err != nil {
-			slog.Warn("repository not found", "source_ip", r.Header.Get("x-forwarded-for"))
+			slog.Warn("webhook for unknown repository", "repo", name)
 			w.WriteHeader(http.StatusNotFound)
 			fmt.Fprintf(w, "Bad Request: Repository not found: %v\n", err)
 			return
 		}
-		// validate key exists in repo config
-		if !repoConfig.validToken(reqToken) {
-			slog.Warn("invalid token for repository", "source_ip", r.Header.Get("x-forwarded-for"))
+
+		if !repoConfig.Webhook.configured() {
+			slog.Warn("webhook not configured for repository", "repo", name)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "Unauthorized\n")
+			return
+		}
+		if !repoConfig.Webhook.verify(body, r) {
+			slog.Warn("invalid webhook signature", "repo", name)
 			w.WriteHeader(http.StatusUnauthorized)
 			fmt.Fprintf(w, "Unauthorized\n")
 			return
 		}
-		// all good
-		slog.Info(repoConfig.Name, "local", repoConfig.Local, "remote", repoConfig.Remote, "branch", repoConfig.Branch)
 
-		syncRepository(*repoConfig)
-	})
+		if event := r.Header.Get("X-GitHub-Event"); event != "" && event != "push" {
+			slog.Info("ignoring non-push webhook event", "repo", name, "event", event)
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "Ignored: event %s is not a push\n", event)
+			return
+		}
+
+		wantRef := fmt.Sprintf("refs/heads/%s", repoConfig.Branch)
+		if payload.Ref == "" || payload.Ref != wantRef {
+			slog.Info("ignoring webhook for non-matching ref", "repo", name, "ref", payload.Ref, "want", wantRef)
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "Ignored: ref %s does not match %s\n", payload.Ref, wantRef)
+			return
+		}
+
+		release, ok := locker.acquire(r.Context(), repoConfig.Name, repoConfig.queueEnabled())
+		if !ok {
+			slog.Warn("sync already in progress", "repo", repoConfig.Name)
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, "Sync already in progress for repository %s\n", repoConfig.Name)
+			return
+		}
+		inFlight.Add(1)
+		defer inFlight.Done()
+		defer release()
+
+		_, newSHA, err := performSync(r.Context(), *repoConfig, config.HooksDir)
+		statuses.get(repoConfig.Name).record(newSHA, err)
+		if err != nil {
+			slog.Error("sync failed", "repo", repoConfig.Name, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Internal Server Error: %v\n", err)
+			return
+		}
+	}
+}
+
+func webhookURLHandler(config *serverConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		repoConfig, err := config.getRepository(name)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Bad Request: Repository not found: %v\n", err)
+			return
+		}
+		if !repoConfig.validToken(tokenFromContext(r.Context())) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "Unauthorized\n")
+			return
+		}
+
+		scheme := "https"
+		if r.TLS == nil {
+			scheme = "http"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			URL         string `json:"url"`
+			ContentType string `json:"content_type"`
+		}{
+			URL:         fmt.Sprintf("%s://%s/webhook/%s", scheme, r.Host, repoConfig.Name),
+			ContentType: "application/json",
+		})
+	}
+}
 
-	fmt.Printf("Listening on %s\n", connStr)
-	err = http.ListenAndServe(connStr, router)
+func main() {
+	configPath, err := getConfigPath()
 	if err != nil {
-		slog.Error("failed to start server", "error", err)
+		fmt.Printf("failed to get config path: %v\n", err)
 		os.Exit(1)
 	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = processConfig(config)
+	if err != nil {
+		fmt.Printf("error in config: %v\n", err)
+		os.Exit(1)
+	}
+
+	connStr := fmt.Sprintf("%s:%s", config.Address, config.Port)
+
+	locker := newSyncLocker()
+	statuses := newStatusStore(config.Repositories)
+	var inFlight sync.WaitGroup
+
+	authed := authMiddleware(config)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthzHandler)
+	mux.HandleFunc("GET /readyz", readyzHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("GET /repos", authed(listReposHandler(config)))
+	mux.Handle("GET /repos/{name}/status", authed(repoStatusHandler(config, statuses)))
+	mux.Handle("POST /sync/{name}", authed(syncHandler(config, locker, &inFlight, statuses)))
+	mux.Handle("POST /batch", authed(batchHandler(config, locker, &inFlight, statuses)))
+	mux.Handle("GET /webhook-url/{name}", authed(webhookURLHandler(config)))
+	// Webhooks authenticate via provider signature, not X-GIT-SYNC-TOKEN.
+	mux.Handle("POST /webhook/{name}", webhookHandler(config, locker, &inFlight, statuses))
+	mux.Handle("POST /webhook", webhookHandler(config, locker, &inFlight, statuses))
+
+	handler := chain(mux, recoverMiddleware, requestIDMiddleware, loggingMiddleware)
+
+	srv := &http.Server{
+		Addr:    connStr,
+		Handler: handler,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		fmt.Printf("Listening on %s\n", connStr)
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("failed to start server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down, waiting for in-flight syncs to finish")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("error during shutdown", "error", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		slog.Warn("timed out waiting for in-flight syncs to finish")
+	}
 }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookConfigVerify(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name    string
+		wc      webhookConfig
+		headers map[string]string
+		want    bool
+	}{
+		{
+			name: "github valid signature",
+			wc:   webhookConfig{Provider: "github", Secret: "s3cret"},
+			headers: map[string]string{
+				"X-Hub-Signature-256": sign("s3cret"),
+			},
+			want: true,
+		},
+		{
+			name: "gitea valid signature",
+			wc:   webhookConfig{Provider: "gitea", Secret: "s3cret"},
+			headers: map[string]string{
+				"X-Hub-Signature-256": sign("s3cret"),
+			},
+			want: true,
+		},
+		{
+			name: "github invalid signature",
+			wc:   webhookConfig{Provider: "github", Secret: "s3cret"},
+			headers: map[string]string{
+				"X-Hub-Signature-256": sign("wrong-secret"),
+			},
+			want: false,
+		},
+		{
+			name:    "github missing signature",
+			wc:      webhookConfig{Provider: "github", Secret: "s3cret"},
+			headers: map[string]string{},
+			want:    false,
+		},
+		{
+			name: "github unprefixed signature",
+			wc:   webhookConfig{Provider: "github", Secret: "s3cret"},
+			headers: map[string]string{
+				"X-Hub-Signature-256": hex.EncodeToString([]byte("not-sha256-prefixed")),
+			},
+			want: false,
+		},
+		{
+			name: "gitlab valid token",
+			wc:   webhookConfig{Provider: "gitlab", Secret: "s3cret"},
+			headers: map[string]string{
+				"X-Gitlab-Token": "s3cret",
+			},
+			want: true,
+		},
+		{
+			name: "gitlab invalid token",
+			wc:   webhookConfig{Provider: "gitlab", Secret: "s3cret"},
+			headers: map[string]string{
+				"X-Gitlab-Token": "wrong",
+			},
+			want: false,
+		},
+		{
+			name: "wrong provider for signature",
+			wc:   webhookConfig{Provider: "gitlab", Secret: "s3cret"},
+			headers: map[string]string{
+				"X-Hub-Signature-256": sign("s3cret"),
+			},
+			want: false,
+		},
+		{
+			name:    "unknown provider",
+			wc:      webhookConfig{Provider: "bitbucket", Secret: "s3cret"},
+			headers: map[string]string{},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := tt.wc.verify(body, req); got != tt.want {
+				t.Errorf("verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncLockerAcquireReject(t *testing.T) {
+	locker := newSyncLocker()
+
+	release, ok := locker.acquire(context.Background(), "repo-a", false)
+	if !ok {
+		t.Fatal("first acquire should succeed")
+	}
+
+	if _, ok := locker.acquire(context.Background(), "repo-a", false); ok {
+		t.Fatal("second acquire with queue=false should be rejected while locked")
+	}
+
+	if _, ok := locker.acquire(context.Background(), "repo-b", false); !ok {
+		t.Fatal("acquire for a different repo name should not be blocked")
+	}
+
+	release()
+
+	if _, ok := locker.acquire(context.Background(), "repo-a", false); !ok {
+		t.Fatal("acquire should succeed once the lock is released")
+	}
+}
+
+func TestSyncLockerAcquireQueue(t *testing.T) {
+	locker := newSyncLocker()
+
+	release, ok := locker.acquire(context.Background(), "repo-a", true)
+	if !ok {
+		t.Fatal("first acquire should succeed")
+	}
+
+	acquired := make(chan bool, 1)
+	go func() {
+		_, ok := locker.acquire(context.Background(), "repo-a", true)
+		acquired <- ok
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("queued acquire should block until the lock is released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case ok := <-acquired:
+		if !ok {
+			t.Fatal("queued acquire should succeed once released")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued acquire did not unblock after release")
+	}
+}
+
+func TestSyncLockerAcquireQueueContextCanceled(t *testing.T) {
+	locker := newSyncLocker()
+
+	_, ok := locker.acquire(context.Background(), "repo-a", true)
+	if !ok {
+		t.Fatal("first acquire should succeed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, ok := locker.acquire(ctx, "repo-a", true); ok {
+		t.Fatal("queued acquire should fail once its context is canceled")
+	}
+}
+
+func newBatchTestConfig(t *testing.T) *serverConfig {
+	t.Helper()
+	return &serverConfig{
+		MaxParallelSyncs: 2,
+		Repositories: []repositoryConfig{
+			{
+				Name:        "repo-a",
+				Local:       t.TempDir() + "/repo-a",
+				Remote:      "/nonexistent/repo-a.git",
+				Branch:      "main",
+				Tokens:      []string{"token-a"},
+				SyncTimeout: duration{Duration: time.Second},
+			},
+			{
+				Name:        "repo-b",
+				Local:       t.TempDir() + "/repo-b",
+				Remote:      "/nonexistent/repo-b.git",
+				Branch:      "main",
+				Tokens:      []string{"token-a"},
+				SyncTimeout: duration{Duration: time.Second},
+			},
+		},
+	}
+}
+
+func TestBatchHandlerRejectsWhenTokenInvalidForAnyRepo(t *testing.T) {
+	config := newBatchTestConfig(t)
+	handler := batchHandler(config, newSyncLocker(), &sync.WaitGroup{}, newStatusStore(config.Repositories))
+
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`{"all":true}`))
+	req = req.WithContext(context.WithValue(req.Context(), ctxKeyToken, "wrong-token"))
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestBatchHandlerAggregatesFailuresAs207(t *testing.T) {
+	config := newBatchTestConfig(t)
+	handler := batchHandler(config, newSyncLocker(), &sync.WaitGroup{}, newStatusStore(config.Repositories))
+
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`{"all":true}`))
+	req = req.WithContext(context.WithValue(req.Context(), ctxKeyToken, "token-a"))
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+
+	var results []batchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("failed to unmarshal response body: %v", err)
+	}
+	if len(results) != len(config.Repositories) {
+		t.Fatalf("len(results) = %d, want %d", len(results), len(config.Repositories))
+	}
+	for _, res := range results {
+		if res.Status != "error" {
+			t.Errorf("repo %s: status = %q, want %q", res.Name, res.Status, "error")
+		}
+	}
+}